@@ -0,0 +1,65 @@
+// Command go-ios-agent runs the long-lived pairing/identity daemon from the tunnel/agent package.
+// Point NewTunnelServiceWithXpc at it via GO_IOS_AGENT_SOCK.
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+
+	"github.com/danielpaulus/go-ios/ios/tunnel"
+	"github.com/danielpaulus/go-ios/ios/tunnel/agent"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	socketPath := flag.String("socket", defaultSocketPath(), "unix socket path to listen on")
+	flag.Parse()
+
+	store := agent.NewStore()
+	if err := seedDefaultIdentity(store); err != nil {
+		log.WithError(err).Fatal("failed to seed go-ios-agent with the default host identity")
+	}
+
+	server := agent.NewServer(store)
+	log.WithField("socket", *socketPath).Info("starting go-ios-agent")
+	if err := server.ListenAndServe(*socketPath); err != nil {
+		log.WithError(err).Fatal("go-ios-agent exited")
+	}
+}
+
+// seedDefaultIdentity registers this workstation's stable HostIdentity so the agent has at least
+// one identity to offer on first start.
+func seedDefaultIdentity(store *agent.Store) error {
+	identity, err := tunnel.LoadOrCreateDefaultHostIdentity()
+	if err != nil {
+		return err
+	}
+	deviceInfo, err := identity.DeviceInfo()
+	if err != nil {
+		return err
+	}
+	store.AddIdentity(agent.Identity{
+		Identifier: identity.AccountID,
+		PublicKey:  identity.PublicKey,
+		PrivateKey: identity.PrivateKey,
+		DeviceInfo: deviceInfo,
+	})
+	return nil
+}
+
+// defaultSocketPath avoids the shared, world-readable os.TempDir() fallback.
+func defaultSocketPath() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".local", "state", "go-ios")
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			log.WithError(err).Fatal("failed to create directory for the agent socket")
+		}
+	}
+	return filepath.Join(dir, "go-ios-agent.sock")
+}
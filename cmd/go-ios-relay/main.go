@@ -0,0 +1,39 @@
+// Command go-ios-relay is the standalone relay process described in ios/tunnel/relay.
+package main
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/danielpaulus/go-ios/ios/tunnel/relay"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	addr := flag.String("addr", ":28100", "address to listen on")
+	token := flag.String("token", "", "bearer token required from hosts and clients; empty disables auth")
+	certFile := flag.String("cert", "", "TLS certificate file (required unless -insecure is set)")
+	keyFile := flag.String("key", "", "TLS key file (required unless -insecure is set)")
+	insecure := flag.Bool("insecure", false, "serve plain ws:// instead of wss://; only for trusted LANs")
+	flag.Parse()
+
+	if !*insecure && (*certFile == "" || *keyFile == "") {
+		log.Fatal("go-ios-relay: -cert and -key are required (device-host traffic and the bearer token would otherwise travel in the clear); pass -insecure to opt out on a trusted LAN")
+	}
+
+	server := relay.NewServer(*token)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/host", server.ServeHost)
+	mux.HandleFunc("/", server.ServeClient)
+
+	log.WithField("addr", *addr).Info("starting go-ios-relay")
+	var err error
+	if *insecure {
+		err = http.ListenAndServe(*addr, mux)
+	} else {
+		err = http.ListenAndServeTLS(*addr, *certFile, *keyFile, mux)
+	}
+	if err != nil {
+		log.WithError(err).Fatal("go-ios-relay exited")
+	}
+}
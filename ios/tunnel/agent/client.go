@@ -0,0 +1,97 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+)
+
+// SockEnvVar mirrors how SSH_AUTH_SOCK works for ssh-agent.
+const SockEnvVar = "GO_IOS_AGENT_SOCK"
+
+// SocketPathFromEnv returns the socket path configured via GO_IOS_AGENT_SOCK, and whether it was set.
+func SocketPathFromEnv() (path string, ok bool) {
+	path = os.Getenv(SockEnvVar)
+	return path, path != ""
+}
+
+// Client talks to a running agent over its Unix domain socket.
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// Dial connects to the agent listening on socketPath.
+func Dial(socketPath string) (*Client, error) {
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return nil, fmt.Errorf("agent: failed to connect to %s: %w", socketPath, err)
+	}
+	return &Client{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) call(req request) (response, error) {
+	if err := writeFrame(c.conn, req); err != nil {
+		return response{}, err
+	}
+	var resp response
+	if err := readFrame(c.r, &resp); err != nil {
+		return response{}, err
+	}
+	return resp, resp.asError()
+}
+
+func (c *Client) ListIdentities() ([]Identity, error) {
+	resp, err := c.call(request{Op: OpListIdentities})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Identities, nil
+}
+
+func (c *Client) AddIdentity(id Identity) error {
+	_, err := c.call(request{Op: OpAddIdentity, Identity: &id})
+	return err
+}
+
+func (c *Client) RemoveIdentity(identifier string) error {
+	_, err := c.call(request{Op: OpRemoveIdentity, Identifier: identifier})
+	return err
+}
+
+// SignWithIdentity asks the agent to sign data without exposing the identity's private key.
+func (c *Client) SignWithIdentity(identifier string, data []byte) ([]byte, error) {
+	resp, err := c.call(request{Op: OpSignWithIdentity, Identifier: identifier, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+func (c *Client) GetSessionKey(udid string) ([]byte, error) {
+	resp, err := c.call(request{Op: OpGetSessionKey, Udid: udid})
+	if err != nil {
+		return nil, err
+	}
+	return resp.SessionKey, nil
+}
+
+func (c *Client) PutSessionKey(udid string, sessionKey []byte) error {
+	_, err := c.call(request{Op: OpPutSessionKey, Udid: udid, SessionKey: sessionKey})
+	return err
+}
+
+// CreateTunnel returns the stored session key for udid; the agent has no XPC/QUIC connection to
+// the device, so the caller builds the TunnelService itself via NewTunnelServiceWithSessionKey.
+func (c *Client) CreateTunnel(udid string) ([]byte, error) {
+	resp, err := c.call(request{Op: OpCreateTunnel, Udid: udid})
+	if err != nil {
+		return nil, err
+	}
+	return resp.SessionKey, nil
+}
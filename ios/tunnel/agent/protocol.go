@@ -0,0 +1,103 @@
+// Package agent implements a long-running pairing/identity daemon for the tunnel package,
+// modeled on ssh-agent: it holds host identities and negotiated SRP session keys so pairing
+// doesn't have to be re-run on every invocation.
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Opcode identifies the operation a request on the agent socket performs.
+type Opcode uint8
+
+const (
+	OpListIdentities Opcode = iota + 1
+	OpAddIdentity
+	OpRemoveIdentity
+	OpSignWithIdentity
+	OpGetSessionKey
+	OpPutSessionKey
+	OpCreateTunnel
+)
+
+// Identity is a host identity the agent can pair and sign on behalf of. PrivateKey is never sent
+// over the wire in a ListIdentities response.
+type Identity struct {
+	Identifier string `json:"identifier"`
+	PublicKey  []byte `json:"publicKey"`
+	PrivateKey []byte `json:"privateKey,omitempty"`
+	// opack-encoded deviceInfo blob presented to the device during pairing
+	DeviceInfo []byte `json:"deviceInfo"`
+}
+
+// request is the envelope every opcode is sent in. Only the fields relevant to Op are populated.
+type request struct {
+	Op         Opcode    `json:"op"`
+	Identifier string    `json:"identifier,omitempty"`
+	Identity   *Identity `json:"identity,omitempty"`
+	Udid       string    `json:"udid,omitempty"`
+	Data       []byte    `json:"data,omitempty"`
+	SessionKey []byte    `json:"sessionKey,omitempty"`
+}
+
+// response is the envelope every opcode answers with. Only the fields relevant to the request's
+// Op are populated.
+type response struct {
+	Error      string     `json:"error,omitempty"`
+	Identities []Identity `json:"identities,omitempty"`
+	Signature  []byte     `json:"signature,omitempty"`
+	SessionKey []byte     `json:"sessionKey,omitempty"`
+}
+
+// writeFrame and readFrame implement a tiny length-prefixed JSON framing: a 4-byte big-endian
+// length header followed by that many bytes of JSON payload.
+func writeFrame(w io.Writer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(b)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// maxFrameSize bounds the length a frame header may declare, to cap readFrame's allocation.
+const maxFrameSize = 16 * 1024 * 1024
+
+func readFrame(r *bufio.Reader, v interface{}) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length > maxFrameSize {
+		return fmt.Errorf("agent: frame of %d bytes exceeds max frame size %d", length, maxFrameSize)
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func errResponse(err error) response {
+	if err == nil {
+		return response{}
+	}
+	return response{Error: err.Error()}
+}
+
+func (r response) asError() error {
+	if r.Error == "" {
+		return nil
+	}
+	return fmt.Errorf("agent: %s", r.Error)
+}
@@ -0,0 +1,32 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestWriteReadFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	req := request{Op: OpGetSessionKey, Udid: "abc123"}
+	if err := writeFrame(&buf, req); err != nil {
+		t.Fatal(err)
+	}
+
+	var got request
+	if err := readFrame(bufio.NewReader(&buf), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Op != req.Op || got.Udid != req.Udid {
+		t.Errorf("got %+v, want %+v", got, req)
+	}
+}
+
+func TestReadFrameRejectsOversizedLength(t *testing.T) {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xff, 0xff, 0xff, 0xff}) // declares a ~4GiB payload
+	var got request
+	if err := readFrame(bufio.NewReader(&buf), &got); err == nil {
+		t.Fatal("expected an oversized frame length to be rejected")
+	}
+}
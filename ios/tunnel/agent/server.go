@@ -0,0 +1,177 @@
+package agent
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Store is the agent's in-memory state: host identities it can sign with, and per-device SRP
+// session keys keyed by udid.
+type Store struct {
+	mu          sync.Mutex
+	identities  map[string]Identity
+	sessionKeys map[string][]byte
+}
+
+func NewStore() *Store {
+	return &Store{
+		identities:  make(map[string]Identity),
+		sessionKeys: make(map[string][]byte),
+	}
+}
+
+// AddIdentity registers id directly, bypassing the wire protocol.
+func (s *Store) AddIdentity(id Identity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.identities[id.Identifier] = id
+}
+
+// Server answers requests on a single Unix domain socket.
+type Server struct {
+	store *Store
+}
+
+func NewServer(store *Store) *Server {
+	return &Server{store: store}
+}
+
+// ListenAndServe accepts connections on socketPath until the listener is closed or an
+// unrecoverable error occurs.
+func (s *Server) ListenAndServe(socketPath string) error {
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("agent: failed to listen on %s: %w", socketPath, err)
+	}
+	defer l.Close()
+	// don't rely on the caller's umask or a private $XDG_RUNTIME_DIR
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return fmt.Errorf("agent: failed to restrict permissions on %s: %w", socketPath, err)
+	}
+	log.WithField("socket", socketPath).Info("go-ios agent listening")
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var req request
+		if err := readFrame(r, &req); err != nil {
+			return
+		}
+		resp := s.handleSafely(req)
+		if err := writeFrame(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// handleSafely recovers from a panic in a single request so it can't take down the daemon.
+func (s *Server) handleSafely(req request) (resp response) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = errResponse(fmt.Errorf("panic handling opcode %d: %v", req.Op, r))
+		}
+	}()
+	return s.handle(req)
+}
+
+func (s *Server) handle(req request) response {
+	switch req.Op {
+	case OpListIdentities:
+		return s.listIdentities()
+	case OpAddIdentity:
+		return s.addIdentity(req)
+	case OpRemoveIdentity:
+		return s.removeIdentity(req)
+	case OpSignWithIdentity:
+		return s.signWithIdentity(req)
+	case OpGetSessionKey:
+		return s.getSessionKey(req)
+	case OpPutSessionKey:
+		return s.putSessionKey(req)
+	case OpCreateTunnel:
+		return s.createTunnel(req)
+	default:
+		return errResponse(fmt.Errorf("unknown opcode %d", req.Op))
+	}
+}
+
+func (s *Server) listIdentities() response {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	identities := make([]Identity, 0, len(s.store.identities))
+	for _, id := range s.store.identities {
+		// never return the private key to the caller, only to the agent itself.
+		identities = append(identities, Identity{Identifier: id.Identifier, PublicKey: id.PublicKey, DeviceInfo: id.DeviceInfo})
+	}
+	return response{Identities: identities}
+}
+
+func (s *Server) addIdentity(req request) response {
+	if req.Identity == nil {
+		return errResponse(fmt.Errorf("ADD_IDENTITY requires an identity"))
+	}
+	if len(req.Identity.PrivateKey) != ed25519.PrivateKeySize {
+		return errResponse(fmt.Errorf("ADD_IDENTITY: private key must be %d bytes, got %d", ed25519.PrivateKeySize, len(req.Identity.PrivateKey)))
+	}
+	if len(req.Identity.PublicKey) != ed25519.PublicKeySize {
+		return errResponse(fmt.Errorf("ADD_IDENTITY: public key must be %d bytes, got %d", ed25519.PublicKeySize, len(req.Identity.PublicKey)))
+	}
+	s.store.AddIdentity(*req.Identity)
+	return response{}
+}
+
+func (s *Server) removeIdentity(req request) response {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	delete(s.store.identities, req.Identifier)
+	return response{}
+}
+
+func (s *Server) signWithIdentity(req request) response {
+	s.store.mu.Lock()
+	id, ok := s.store.identities[req.Identifier]
+	s.store.mu.Unlock()
+	if !ok {
+		return errResponse(fmt.Errorf("no such identity: %s", req.Identifier))
+	}
+	sig := ed25519.Sign(ed25519.PrivateKey(id.PrivateKey), req.Data)
+	return response{Signature: sig}
+}
+
+func (s *Server) getSessionKey(req request) response {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	key, ok := s.store.sessionKeys[req.Udid]
+	if !ok {
+		return errResponse(fmt.Errorf("no session key stored for udid %s", req.Udid))
+	}
+	return response{SessionKey: key}
+}
+
+func (s *Server) putSessionKey(req request) response {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	s.store.sessionKeys[req.Udid] = req.SessionKey
+	return response{}
+}
+
+// createTunnel answers CREATE_TUNNEL with the stored session key; the agent has no XPC/QUIC
+// connection to dial the tunnel itself.
+func (s *Server) createTunnel(req request) response {
+	return s.getSessionKey(req)
+}
@@ -0,0 +1,196 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/danielpaulus/go-ios/ios/opack"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/ed25519"
+)
+
+// HostIdentity is what Pair presents to the device: the opack deviceInfo fields plus the ed25519
+// keypair used to sign the pairing proof.
+type HostIdentity struct {
+	AccountID    string `json:"accountID"`
+	AltIRK       []byte `json:"altIRK"`
+	BtAddr       string `json:"btAddr"`
+	Mac          []byte `json:"mac"`
+	Model        string `json:"model"`
+	Name         string `json:"name"`
+	SerialNumber string `json:"serialNumber"`
+
+	PublicKey  ed25519.PublicKey  `json:"-"`
+	PrivateKey ed25519.PrivateKey `json:"-"`
+}
+
+// persistedHostIdentity mirrors HostIdentity for JSON (de)serialization, PEM-wrapping the keys.
+type persistedHostIdentity struct {
+	AccountID     string `json:"accountID"`
+	AltIRK        []byte `json:"altIRK"`
+	BtAddr        string `json:"btAddr"`
+	Mac           []byte `json:"mac"`
+	Model         string `json:"model"`
+	Name          string `json:"name"`
+	SerialNumber  string `json:"serialNumber"`
+	PublicKeyPEM  string `json:"publicKeyPem"`
+	PrivateKeyPEM string `json:"privateKeyPem"`
+}
+
+// NewHostIdentity generates a fresh identity with a random ed25519 keypair, accountID, altIRK,
+// MAC, btAddr and serial number; Model and Name are fixed values.
+func NewHostIdentity() (HostIdentity, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return HostIdentity{}, err
+	}
+	altIRK := make([]byte, 16)
+	if _, err := rand.Read(altIRK); err != nil {
+		return HostIdentity{}, err
+	}
+	mac := make([]byte, 6)
+	if _, err := rand.Read(mac); err != nil {
+		return HostIdentity{}, err
+	}
+	btAddr := make([]byte, 6)
+	if _, err := rand.Read(btAddr); err != nil {
+		return HostIdentity{}, err
+	}
+	return HostIdentity{
+		AccountID:    uuid.New().String(),
+		AltIRK:       altIRK,
+		BtAddr:       fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", btAddr[0], btAddr[1], btAddr[2], btAddr[3], btAddr[4], btAddr[5]),
+		Mac:          mac,
+		Model:        "MacBookPro18,3",
+		Name:         "go-ios",
+		SerialNumber: uuid.New().String()[:10],
+		PublicKey:    public,
+		PrivateKey:   private,
+	}, nil
+}
+
+// DeviceInfo opack-encodes the identity the way Pair sends it to the device.
+func (h HostIdentity) DeviceInfo() ([]byte, error) {
+	return opack.Encode(map[string]interface{}{
+		"accountID":                   h.AccountID,
+		"altIRK":                      h.AltIRK,
+		"btAddr":                      h.BtAddr,
+		"mac":                         h.Mac,
+		"model":                       h.Model,
+		"name":                        h.Name,
+		"remotepairing_serial_number": h.SerialNumber,
+	})
+}
+
+// DefaultHostIdentityPath follows the XDG base directory spec.
+func DefaultHostIdentityPath() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "go-ios", "host_identity.json")
+}
+
+// LoadOrCreateDefaultHostIdentity loads the identity at DefaultHostIdentityPath, generating and
+// saving a new one on first run.
+func LoadOrCreateDefaultHostIdentity() (HostIdentity, error) {
+	path := DefaultHostIdentityPath()
+	id, err := LoadHostIdentity(path)
+	if err == nil {
+		return id, nil
+	}
+	if !os.IsNotExist(err) {
+		return HostIdentity{}, err
+	}
+	id, err = NewHostIdentity()
+	if err != nil {
+		return HostIdentity{}, err
+	}
+	if err := SaveHostIdentity(path, id); err != nil {
+		return HostIdentity{}, err
+	}
+	return id, nil
+}
+
+// LoadHostIdentity reads a HostIdentity previously written by SaveHostIdentity.
+func LoadHostIdentity(path string) (HostIdentity, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return HostIdentity{}, err
+	}
+	var p persistedHostIdentity
+	if err := json.Unmarshal(b, &p); err != nil {
+		return HostIdentity{}, fmt.Errorf("failed to parse host identity at %s: %w", path, err)
+	}
+
+	publicBlock, _ := pem.Decode([]byte(p.PublicKeyPEM))
+	if publicBlock == nil {
+		return HostIdentity{}, fmt.Errorf("host identity at %s has no PEM-encoded public key", path)
+	}
+	public, err := x509.ParsePKIXPublicKey(publicBlock.Bytes)
+	if err != nil {
+		return HostIdentity{}, fmt.Errorf("failed to parse public key in %s: %w", path, err)
+	}
+	privateBlock, _ := pem.Decode([]byte(p.PrivateKeyPEM))
+	if privateBlock == nil {
+		return HostIdentity{}, fmt.Errorf("host identity at %s has no PEM-encoded private key", path)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(privateBlock.Bytes)
+	if err != nil {
+		return HostIdentity{}, fmt.Errorf("failed to parse private key in %s: %w", path, err)
+	}
+
+	return HostIdentity{
+		AccountID:    p.AccountID,
+		AltIRK:       p.AltIRK,
+		BtAddr:       p.BtAddr,
+		Mac:          p.Mac,
+		Model:        p.Model,
+		Name:         p.Name,
+		SerialNumber: p.SerialNumber,
+		PublicKey:    public.(ed25519.PublicKey),
+		PrivateKey:   private.(ed25519.PrivateKey),
+	}, nil
+}
+
+// SaveHostIdentity writes id to path as JSON with the keys PEM-wrapped and the file mode 0600.
+func SaveHostIdentity(path string, id HostIdentity) error {
+	publicDer, err := x509.MarshalPKIXPublicKey(id.PublicKey)
+	if err != nil {
+		return err
+	}
+	privateDer, err := x509.MarshalPKCS8PrivateKey(id.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	p := persistedHostIdentity{
+		AccountID:     id.AccountID,
+		AltIRK:        id.AltIRK,
+		BtAddr:        id.BtAddr,
+		Mac:           id.Mac,
+		Model:         id.Model,
+		Name:          id.Name,
+		SerialNumber:  id.SerialNumber,
+		PublicKeyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})),
+		PrivateKeyPEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDer})),
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0600)
+}
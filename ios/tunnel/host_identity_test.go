@@ -0,0 +1,33 @@
+package tunnel
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoadHostIdentityRoundTrip(t *testing.T) {
+	id, err := NewHostIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "host_identity.json")
+	if err := SaveHostIdentity(path, id); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadHostIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.AccountID != id.AccountID {
+		t.Errorf("AccountID: got %q, want %q", loaded.AccountID, id.AccountID)
+	}
+	if !loaded.PublicKey.Equal(id.PublicKey) {
+		t.Errorf("PublicKey did not round-trip through PEM")
+	}
+	if !loaded.PrivateKey.Equal(id.PrivateKey) {
+		t.Errorf("PrivateKey did not round-trip through PEM")
+	}
+}
@@ -0,0 +1,58 @@
+package relay
+
+import (
+	"io"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// streamBridge pipes bytes between streams a client opened on its own Multiplexer and matching
+// streams the relay server opens on the registered host's Multiplexer, so neither side has to
+// know it is talking through a relay rather than directly to its peer.
+type streamBridge struct {
+	hostMux *Multiplexer
+
+	mu    sync.Mutex
+	pairs []io.Closer
+}
+
+func newStreamBridge(hostMux *Multiplexer) *streamBridge {
+	return &streamBridge{hostMux: hostMux}
+}
+
+func (b *streamBridge) openOnHost(clientMux *Multiplexer, clientStreamID uint32, meta []byte) {
+	clientMux.streamsMu.Lock()
+	clientStream := clientMux.streams[clientStreamID]
+	clientMux.streamsMu.Unlock()
+	if clientStream == nil {
+		return
+	}
+
+	hostStream, err := b.hostMux.Open(meta)
+	if err != nil {
+		log.WithError(err).Warn("relay: failed opening stream on host connection")
+		clientStream.Close()
+		return
+	}
+
+	b.mu.Lock()
+	b.pairs = append(b.pairs, clientStream, hostStream)
+	b.mu.Unlock()
+
+	go pipe(hostStream, clientStream)
+	go pipe(clientStream, hostStream)
+}
+
+func (b *streamBridge) closeAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, c := range b.pairs {
+		c.Close()
+	}
+}
+
+func pipe(dst io.WriteCloser, src io.Reader) {
+	defer dst.Close()
+	io.Copy(dst, src)
+}
@@ -0,0 +1,49 @@
+package relay
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/danielpaulus/go-ios/ios/xpc"
+	"github.com/gorilla/websocket"
+)
+
+// DialRemoteTunnelService opens a stream to the tunnelservice XPC connection of the device
+// identified by udid. The returned xpc.Connection can be passed to tunnel.NewTunnelServiceWithXpc
+// exactly as a local connection would be.
+func DialRemoteTunnelService(relayURL, udid string) (*xpc.Connection, io.Closer, error) {
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("relay: invalid relay URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("udid", udid)
+	u.RawQuery = q.Encode()
+
+	ws, _, err := websocket.DefaultDialer.Dial(u.String(), http.Header{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("relay: failed to dial relay at %s: %w", u.String(), err)
+	}
+
+	mux := NewMultiplexer(ws, nil)
+	go mux.Serve()
+
+	stream, err := mux.Open([]byte(udid))
+	if err != nil {
+		ws.Close()
+		return nil, nil, fmt.Errorf("relay: failed to open stream for udid %s: %w", udid, err)
+	}
+
+	conn := xpc.New(stream)
+	closer := closerFunc(func() error {
+		stream.Close()
+		return ws.Close()
+	})
+	return conn, closer, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
@@ -0,0 +1,63 @@
+// Package relay lets the tunnel control channel and data channels be reached over a WebSocket
+// relay instead of a local XPC connection, so a device plugged into a remote machine can be
+// driven from elsewhere. A single WebSocket connection carries many logical streams multiplexed
+// with a tiny frame header.
+package relay
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FrameType distinguishes control traffic, tunnel payload, and stream lifecycle events sharing
+// one WebSocket connection.
+type FrameType uint8
+
+const (
+	FrameTypeControl FrameType = iota
+	FrameTypeTunnelData
+	FrameTypeOpen
+	FrameTypeClose
+)
+
+// frameHeaderSize is 4 bytes of streamID, 1 byte of type, 4 bytes of length.
+const frameHeaderSize = 9
+
+// Frame is one multiplexed unit of data; StreamID identifies which logical stream it belongs to.
+type Frame struct {
+	StreamID uint32
+	Type     FrameType
+	Payload  []byte
+}
+
+func (f Frame) marshal() []byte {
+	b := make([]byte, frameHeaderSize+len(f.Payload))
+	binary.BigEndian.PutUint32(b[0:4], f.StreamID)
+	b[4] = byte(f.Type)
+	binary.BigEndian.PutUint32(b[5:9], uint32(len(f.Payload)))
+	copy(b[9:], f.Payload)
+	return b
+}
+
+func unmarshalFrame(b []byte) (Frame, error) {
+	if len(b) < frameHeaderSize {
+		return Frame{}, fmt.Errorf("relay: frame shorter than header (%d bytes)", len(b))
+	}
+	length := binary.BigEndian.Uint32(b[5:9])
+	if int(length) != len(b)-frameHeaderSize {
+		return Frame{}, fmt.Errorf("relay: frame length mismatch: header says %d, got %d", length, len(b)-frameHeaderSize)
+	}
+	return Frame{
+		StreamID: binary.BigEndian.Uint32(b[0:4]),
+		Type:     FrameType(b[4]),
+		Payload:  b[9:],
+	}, nil
+}
+
+// wsConn is the minimal surface this package needs from a WebSocket connection.
+type wsConn interface {
+	io.Closer
+	WriteMessage(messageType int, data []byte) error
+	ReadMessage() (messageType int, p []byte, err error)
+}
@@ -0,0 +1,20 @@
+package relay
+
+import "testing"
+
+func TestFrameMarshalUnmarshalRoundTrip(t *testing.T) {
+	f := Frame{StreamID: 7, Type: FrameTypeTunnelData, Payload: []byte("hello")}
+	got, err := unmarshalFrame(f.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.StreamID != f.StreamID || got.Type != f.Type || string(got.Payload) != string(f.Payload) {
+		t.Errorf("got %+v, want %+v", got, f)
+	}
+}
+
+func TestUnmarshalFrameRejectsShortInput(t *testing.T) {
+	if _, err := unmarshalFrame([]byte{1, 2, 3}); err == nil {
+		t.Fatal("expected an error for input shorter than the frame header")
+	}
+}
@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// Host runs on the machine the iOS device is physically plugged into. It dials out to a relay
+// server over WebSocket and, for every stream the relay opens on its behalf, hands the stream to
+// DialLocal to connect it to the real local resource.
+type Host struct {
+	// ws:// or wss:// address of the relay server's /host endpoint
+	RelayURL string
+	// identifies this host to the relay server when several are connected
+	Fingerprint string
+	// sent as a bearer token on the initial HTTP upgrade request
+	Token string
+	// called for every stream the relay opens on this host's behalf; meta is the opaque payload
+	// passed to Multiplexer.Open
+	DialLocal func(stream *Stream, meta []byte)
+
+	// bounds the wait between reconnects; defaults to a 1s-30s exponential backoff when zero
+	ReconnectBackoff func(attempt int) time.Duration
+}
+
+// Serve connects to the relay and keeps reconnecting with backoff until stop is closed or the
+// caller's goroutine is torn down another way. It blocks, so run it in its own goroutine.
+func (h *Host) Serve(stop <-chan struct{}) error {
+	backoff := h.ReconnectBackoff
+	if backoff == nil {
+		backoff = defaultBackoff
+	}
+	attempt := 0
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		if err := h.serveOnce(); err != nil {
+			log.WithError(err).WithField("fingerprint", h.Fingerprint).Warn("relay host connection dropped, reconnecting")
+		}
+		attempt++
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(backoff(attempt)):
+		}
+	}
+}
+
+func (h *Host) serveOnce() error {
+	u, err := url.Parse(h.RelayURL)
+	if err != nil {
+		return fmt.Errorf("relay: invalid relay URL: %w", err)
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+h.Token)
+	header.Set("X-Go-Ios-Fingerprint", h.Fingerprint)
+	ws, _, err := websocket.DefaultDialer.Dial(u.String(), header)
+	if err != nil {
+		return fmt.Errorf("relay: failed to dial %s: %w", u.String(), err)
+	}
+	defer ws.Close()
+
+	var mux *Multiplexer
+	mux = NewMultiplexer(ws, func(streamID uint32, meta []byte) {
+		if h.DialLocal == nil {
+			return
+		}
+		h.streamOpened(mux, streamID, meta)
+	})
+	return mux.Serve()
+}
+
+func (h *Host) streamOpened(mux *Multiplexer, streamID uint32, meta []byte) {
+	mux.streamsMu.Lock()
+	s := mux.streams[streamID]
+	mux.streamsMu.Unlock()
+	if s == nil {
+		return
+	}
+	go h.DialLocal(s, meta)
+}
+
+func defaultBackoff(attempt int) time.Duration {
+	d := time.Second << uint(attempt-1)
+	if d > 30*time.Second || d <= 0 {
+		d = 30 * time.Second
+	}
+	return d
+}
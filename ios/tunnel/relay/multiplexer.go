@@ -0,0 +1,176 @@
+package relay
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Multiplexer shares one WebSocket connection between many logical streams, dispatching inbound
+// frames to the right Stream and serializing outbound frames from all of them.
+type Multiplexer struct {
+	ws wsConn
+
+	writeMu sync.Mutex
+
+	streamsMu sync.Mutex
+	streams   map[uint32]*Stream
+	nextID    uint32
+
+	onOpen func(streamID uint32, meta []byte)
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewMultiplexer wraps an established WebSocket connection. onOpen, if non-nil, is invoked
+// whenever the peer opens a new stream.
+func NewMultiplexer(ws wsConn, onOpen func(streamID uint32, meta []byte)) *Multiplexer {
+	return &Multiplexer{ws: ws, streams: make(map[uint32]*Stream), onOpen: onOpen}
+}
+
+// Open allocates a new stream and tells the peer about it with a FrameTypeOpen frame; meta is an
+// opaque payload carried on that frame only.
+func (m *Multiplexer) Open(meta []byte) (*Stream, error) {
+	id := atomic.AddUint32(&m.nextID, 1)
+	s := m.registerStream(id)
+	if err := m.writeFrame(Frame{StreamID: id, Type: FrameTypeOpen, Payload: meta}); err != nil {
+		m.removeStream(id)
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m *Multiplexer) registerStream(id uint32) *Stream {
+	s := newStream(id, m)
+	m.streamsMu.Lock()
+	m.streams[id] = s
+	m.streamsMu.Unlock()
+	return s
+}
+
+func (m *Multiplexer) removeStream(id uint32) {
+	m.streamsMu.Lock()
+	delete(m.streams, id)
+	m.streamsMu.Unlock()
+}
+
+func (m *Multiplexer) writeFrame(f Frame) error {
+	m.writeMu.Lock()
+	defer m.writeMu.Unlock()
+	return m.ws.WriteMessage(websocket.BinaryMessage, f.marshal())
+}
+
+// Serve reads frames off the underlying connection until it is closed, dispatching each to its
+// stream's inbound queue. It blocks, so callers typically run it in its own goroutine.
+func (m *Multiplexer) Serve() error {
+	for {
+		_, b, err := m.ws.ReadMessage()
+		if err != nil {
+			return m.shutdown(err)
+		}
+		f, err := unmarshalFrame(b)
+		if err != nil {
+			return m.shutdown(err)
+		}
+		switch f.Type {
+		case FrameTypeOpen:
+			m.registerStream(f.StreamID)
+			if m.onOpen != nil {
+				m.onOpen(f.StreamID, f.Payload)
+			}
+		case FrameTypeClose:
+			m.streamsMu.Lock()
+			s := m.streams[f.StreamID]
+			m.streamsMu.Unlock()
+			if s != nil {
+				s.closeLocal()
+			}
+			m.removeStream(f.StreamID)
+		case FrameTypeControl, FrameTypeTunnelData:
+			m.streamsMu.Lock()
+			s := m.streams[f.StreamID]
+			m.streamsMu.Unlock()
+			if s == nil {
+				continue
+			}
+			s.deliver(f.Payload)
+		}
+	}
+}
+
+func (m *Multiplexer) shutdown(err error) error {
+	m.closeOnce.Do(func() {
+		m.closeErr = err
+		m.streamsMu.Lock()
+		streams := make([]*Stream, 0, len(m.streams))
+		for _, s := range m.streams {
+			streams = append(streams, s)
+		}
+		m.streamsMu.Unlock()
+		for _, s := range streams {
+			s.closeLocal()
+		}
+	})
+	return m.closeErr
+}
+
+// Stream is an io.ReadWriteCloser backed by one multiplexed logical stream.
+type Stream struct {
+	id  uint32
+	mux *Multiplexer
+
+	mu     sync.Mutex
+	buf    []byte
+	cond   *sync.Cond
+	closed bool
+}
+
+func newStream(id uint32, mux *Multiplexer) *Stream {
+	s := &Stream{id: id, mux: mux}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *Stream) deliver(payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf, payload...)
+	s.cond.Broadcast()
+}
+
+func (s *Stream) closeLocal() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.buf) == 0 && !s.closed {
+		s.cond.Wait()
+	}
+	if len(s.buf) == 0 && s.closed {
+		return 0, io.EOF
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *Stream) Write(p []byte) (int, error) {
+	if err := s.mux.writeFrame(Frame{StreamID: s.id, Type: FrameTypeTunnelData, Payload: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *Stream) Close() error {
+	s.closeLocal()
+	s.mux.removeStream(s.id)
+	return s.mux.writeFrame(Frame{StreamID: s.id, Type: FrameTypeClose})
+}
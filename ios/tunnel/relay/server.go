@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// Server is the standalone relay process: device-hosts dial in on /host and register the udids
+// they can reach; clients dial in on / with a udid query parameter and get proxied through to
+// whichever host most recently registered that udid.
+type Server struct {
+	// Token, if set, is required as a Bearer token on both /host and client connections.
+	Token string
+
+	mu    sync.Mutex
+	hosts map[string]*registeredHost // keyed by udid
+}
+
+type registeredHost struct {
+	fingerprint string
+	mux         *Multiplexer
+}
+
+func NewServer(token string) *Server {
+	return &Server{Token: token, hosts: make(map[string]*registeredHost)}
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	got := r.Header.Get("Authorization")
+	want := "Bearer " + s.Token
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// ServeHost handles a device-host's long-lived WebSocket connection, declaring udids via the
+// "udids" query parameter (comma separated) and its fingerprint via X-Go-Ios-Fingerprint.
+func (s *Server) ServeHost(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	fingerprint := r.Header.Get("X-Go-Ios-Fingerprint")
+	udids := strings.Split(r.URL.Query().Get("udids"), ",")
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.WithError(err).Warn("relay: failed to upgrade host connection")
+		return
+	}
+	defer ws.Close()
+
+	mux := NewMultiplexer(ws, nil)
+	rh := &registeredHost{fingerprint: fingerprint, mux: mux}
+
+	s.mu.Lock()
+	for _, udid := range udids {
+		if udid == "" {
+			continue
+		}
+		s.hosts[udid] = rh
+	}
+	s.mu.Unlock()
+	log.WithField("fingerprint", fingerprint).WithField("udids", udids).Info("relay: host registered")
+
+	defer func() {
+		s.mu.Lock()
+		for udid, h := range s.hosts {
+			if h == rh {
+				delete(s.hosts, udid)
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	if err := mux.Serve(); err != nil {
+		log.WithError(err).WithField("fingerprint", fingerprint).Warn("relay: host connection closed")
+	}
+}
+
+// ServeClient relays frames between a client requesting a single udid and the registered host's
+// multiplexer, opening a matching stream there for every stream the client opens.
+func (s *Server) ServeClient(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	udid := r.URL.Query().Get("udid")
+	s.mu.Lock()
+	host, ok := s.hosts[udid]
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("no host registered for udid %s", udid), http.StatusNotFound)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.WithError(err).Warn("relay: failed to upgrade client connection")
+		return
+	}
+	defer ws.Close()
+
+	bridge := newStreamBridge(host.mux)
+	var clientMux *Multiplexer
+	clientMux = NewMultiplexer(ws, func(streamID uint32, meta []byte) {
+		bridge.openOnHost(clientMux, streamID, meta)
+	})
+	if err := clientMux.Serve(); err != nil {
+		log.WithError(err).WithField("udid", udid).Warn("relay: client connection closed")
+	}
+	bridge.closeAll()
+}
@@ -0,0 +1,118 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lengthPrefixedConn frames reads and writes on a TLS-on-TCP connection with a 4-byte big-endian
+// length prefix, giving it the same packet boundaries QUIC datagrams provide.
+type lengthPrefixedConn struct {
+	net.Conn
+}
+
+func (c lengthPrefixedConn) WritePacket(b []byte) error {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(b)))
+	if _, err := c.Write(header); err != nil {
+		return err
+	}
+	_, err := c.Write(b)
+	return err
+}
+
+func (c lengthPrefixedConn) ReadPacket() ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(c, header); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(c, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// DialTCPTunnel connects to the TCP listener created by CreateTunnelListenerWithOptions with
+// TransportTypeTcp, pinning the device's public key instead of validating a certificate chain.
+func DialTCPTunnel(addr string, listener TunnelListener) (lengthPrefixedConn, error) {
+	if listener.TransportType != TransportTypeTcp {
+		return lengthPrefixedConn{}, fmt.Errorf("listener was created for transport %q, not tcp", listener.TransportType)
+	}
+
+	cert, err := selfSignedCertFor(listener.PrivateKey)
+	if err != nil {
+		return lengthPrefixedConn{}, fmt.Errorf("failed building client certificate: %w", err)
+	}
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		Certificates:       []tls.Certificate{cert},
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyDevicePublicKey(rawCerts, listener.DevicePublicKey)
+		},
+	})
+	if err != nil {
+		return lengthPrefixedConn{}, fmt.Errorf("failed dialing tcp tunnel listener: %w", err)
+	}
+	log.WithField("addr", addr).Info("established tcp tunnel transport")
+	return lengthPrefixedConn{Conn: conn}, nil
+}
+
+// selfSignedCertFor builds a minimal self-signed X.509 certificate for key to present as a TLS
+// client certificate; the device only cares that the handshake succeeds.
+func selfSignedCertFor(key *rsa.PrivateKey) (tls.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	notBefore := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "go-ios tcp tunnel transport"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.AddDate(1, 0, 0),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
+
+// verifyDevicePublicKey pins the TLS peer to the device public key negotiated out of band during
+// CreateTunnelListenerWithOptions, rather than trusting any certificate the peer presents.
+func verifyDevicePublicKey(rawCerts [][]byte, expected interface{}) error {
+	expectedDer, err := x509.MarshalPKIXPublicKey(expected)
+	if err != nil {
+		return err
+	}
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			continue
+		}
+		certDer, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+		if err != nil {
+			continue
+		}
+		if string(certDer) == string(expectedDer) {
+			return nil
+		}
+	}
+	return fmt.Errorf("device certificate did not match the public key negotiated during createListener")
+}
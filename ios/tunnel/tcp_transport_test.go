@@ -0,0 +1,60 @@
+package tunnel
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+)
+
+func TestVerifyDevicePublicKeyAcceptsMatchingCert(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := selfSignedCertFor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyDevicePublicKey(cert.Certificate, &key.PublicKey); err != nil {
+		t.Fatalf("expected cert to verify against its own key, got: %v", err)
+	}
+}
+
+func TestVerifyDevicePublicKeyRejectsOtherKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := selfSignedCertFor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := verifyDevicePublicKey(cert.Certificate, &other.PublicKey); err == nil {
+		t.Fatal("expected verification against an unrelated key to fail")
+	}
+}
+
+func TestSelfSignedCertForIsParseable(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := selfSignedCertFor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Certificate) != 1 {
+		t.Fatalf("expected exactly one certificate, got %d", len(cert.Certificate))
+	}
+	if _, err := x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		t.Fatalf("selfSignedCertFor produced a cert that doesn't parse: %v", err)
+	}
+}
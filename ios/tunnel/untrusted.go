@@ -10,9 +10,8 @@ import (
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
-	"github.com/danielpaulus/go-ios/ios/opack"
+	"github.com/danielpaulus/go-ios/ios/tunnel/agent"
 	"github.com/danielpaulus/go-ios/ios/xpc"
-	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/ed25519"
@@ -30,6 +29,16 @@ func NewTunnelServiceWithXpc(xpcConn *xpc.Connection, c io.Closer) (*TunnelServi
 	return &TunnelService{xpcConn: xpcConn, c: c, key: key, messageReadWriter: newControlChannelCodec()}, nil
 }
 
+// NewTunnelServiceWithIdentity is like NewTunnelServiceWithXpc, but Pair presents identity instead
+// of the persisted default from LoadOrCreateDefaultHostIdentity.
+func NewTunnelServiceWithIdentity(xpcConn *xpc.Connection, c io.Closer, identity HostIdentity) (*TunnelService, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &TunnelService{xpcConn: xpcConn, c: c, key: key, messageReadWriter: newControlChannelCodec(), identity: &identity}, nil
+}
+
 func NewTunnelServiceWithSessionKey(conn *xpc.Connection, c io.Closer, sessionKey []byte) (*TunnelService, error) {
 	ts := &TunnelService{
 		xpcConn:           conn,
@@ -53,6 +62,15 @@ type TunnelService struct {
 	serverEncryption  cipher.AEAD
 	cs                *cipherStream
 	messageReadWriter *controlChannelCodec
+
+	// udid is set by SetUdid; agentClient is set when Pair resolved its identity through a
+	// reachable go-ios agent
+	udid        string
+	agentClient *agent.Client
+
+	// presented to the device by Pair instead of the persisted default identity; ignored if a
+	// reachable agent offers an identity
+	identity *HostIdentity
 }
 
 type PairInfo struct {
@@ -129,33 +147,27 @@ func (t *TunnelService) Pair() (PairInfo, error) {
 		return PairInfo{}, fmt.Errorf("could not verify server proof")
 	}
 
-	identifier := uuid.New()
-	public, private, err := ed25519.GenerateKey(rand.Reader)
+	identifier, public, deviceInfo, sign, closeIdentity, err := t.resolvePairingIdentity()
+	if err != nil {
+		return PairInfo{}, err
+	}
+	defer closeIdentity()
+
 	hkdfPairSetup := hkdf.New(sha512.New, srp.SessionKey, []byte("Pair-Setup-Controller-Sign-Salt"), []byte("Pair-Setup-Controller-Sign-Info"))
 	buf := bytes.NewBuffer(nil)
 	io.CopyN(buf, hkdfPairSetup, 32)
-	buf.WriteString(identifier.String())
+	buf.WriteString(identifier)
 	buf.Write(public)
 
+	signature, err := sign(buf.Bytes())
 	if err != nil {
 		return PairInfo{}, err
 	}
-	signature := ed25519.Sign(private, buf.Bytes())
-
-	deviceInfo, err := opack.Encode(map[string]interface{}{
-		"accountID":                   identifier.String(),
-		"altIRK":                      []byte{0x5e, 0xca, 0x81, 0x91, 0x92, 0x02, 0x82, 0x00, 0x11, 0x22, 0x33, 0x44, 0xbb, 0xf2, 0x4a, 0xc8},
-		"btAddr":                      "FF:DD:99:66:BB:AA",
-		"mac":                         []byte{0xff, 0x44, 0x88, 0x66, 0x33, 0x99},
-		"model":                       "MacBookPro18,3",
-		"name":                        "host-name",
-		"remotepairing_serial_number": "YY9944YY99",
-	})
 
 	deviceInfoTlv := NewTlvBuffer()
 	deviceInfoTlv.WriteData(TypeSignature, signature)
 	deviceInfoTlv.WriteData(TypePublicKey, public)
-	deviceInfoTlv.WriteData(TypeIdentifier, []byte(identifier.String()))
+	deviceInfoTlv.WriteData(TypeIdentifier, []byte(identifier))
 	deviceInfoTlv.WriteData(TypeInfo, deviceInfo)
 
 	sessionKeyBuf := bytes.NewBuffer(nil)
@@ -219,11 +231,121 @@ func (t *TunnelService) Pair() (PairInfo, error) {
 		return PairInfo{}, err
 	}
 
+	if t.agentClient != nil && t.udid != "" {
+		if err := t.agentClient.PutSessionKey(t.udid, srp.SessionKey); err != nil {
+			log.WithError(err).Warn("failed to persist session key with go-ios agent")
+		}
+	}
+
 	return PairInfo{SessionKey: srp.SessionKey}, nil
 }
 
+// SetUdid tells the TunnelService which device it is pairing with, so a reachable go-ios agent
+// can persist the session key under that udid for ResumeOrPair to resume from later.
+func (t *TunnelService) SetUdid(udid string) {
+	t.udid = udid
+}
+
+// ResumeOrPair resumes from a session key held by a reachable go-ios agent, skipping the SRP
+// handshake, or falls back to a fresh Pair if none is available.
+func ResumeOrPair(xpcConn *xpc.Connection, c io.Closer, udid string) (*TunnelService, PairInfo, error) {
+	if socketPath, ok := agent.SocketPathFromEnv(); ok {
+		client, err := agent.Dial(socketPath)
+		if err != nil {
+			log.WithError(err).Warn("GO_IOS_AGENT_SOCK is set but the agent is not reachable, pairing instead of resuming")
+		} else {
+			defer client.Close()
+			if sessionKey, err := client.GetSessionKey(udid); err == nil && len(sessionKey) > 0 {
+				ts, err := NewTunnelServiceWithSessionKey(xpcConn, c, sessionKey)
+				if err != nil {
+					return nil, PairInfo{}, err
+				}
+				return ts, PairInfo{SessionKey: sessionKey}, nil
+			}
+		}
+	}
+
+	ts, err := NewTunnelServiceWithXpc(xpcConn, c)
+	if err != nil {
+		return nil, PairInfo{}, err
+	}
+	ts.SetUdid(udid)
+	pairInfo, err := ts.Pair()
+	if err != nil {
+		return nil, PairInfo{}, err
+	}
+	return ts, pairInfo, nil
+}
+
+// resolvePairingIdentity picks the identity Pair presents to the device: a reachable go-ios
+// agent first, then the identity passed to NewTunnelServiceWithIdentity, then the persisted
+// default.
+func (t *TunnelService) resolvePairingIdentity() (identifier string, public ed25519.PublicKey, deviceInfo []byte, sign func([]byte) ([]byte, error), closeIdentity func(), err error) {
+	closeIdentity = func() {}
+
+	if socketPath, ok := agent.SocketPathFromEnv(); ok {
+		client, dialErr := agent.Dial(socketPath)
+		if dialErr != nil {
+			log.WithError(dialErr).Warn("GO_IOS_AGENT_SOCK is set but the agent is not reachable, falling back to local identity")
+		} else {
+			identities, listErr := client.ListIdentities()
+			if listErr != nil || len(identities) == 0 {
+				client.Close()
+				log.WithError(listErr).Warn("go-ios agent has no identities, falling back to local identity")
+			} else {
+				id := identities[0]
+				t.agentClient = client
+				return id.Identifier, ed25519.PublicKey(id.PublicKey), id.DeviceInfo, func(data []byte) ([]byte, error) {
+					return client.SignWithIdentity(id.Identifier, data)
+				}, func() { client.Close() }, nil
+			}
+		}
+	}
+
+	identity := t.identity
+	if identity == nil {
+		id, loadErr := LoadOrCreateDefaultHostIdentity()
+		if loadErr != nil {
+			return "", nil, nil, nil, closeIdentity, fmt.Errorf("failed to load or create default host identity: %w", loadErr)
+		}
+		identity = &id
+	}
+
+	deviceInfo, err = identity.DeviceInfo()
+	if err != nil {
+		return "", nil, nil, nil, closeIdentity, err
+	}
+	return identity.AccountID, identity.PublicKey, deviceInfo, func(data []byte) ([]byte, error) {
+		return ed25519.Sign(identity.PrivateKey, data), nil
+	}, closeIdentity, nil
+}
+
+// TransportType selects the wire protocol used for the tunnel data channel.
+type TransportType string
+
+const (
+	TransportTypeQuic TransportType = "quic"
+	TransportTypeTcp  TransportType = "tcp"
+)
+
+// TunnelListenerOptions configures CreateTunnelListenerWithOptions. The zero value selects QUIC.
+type TunnelListenerOptions struct {
+	TransportType TransportType
+}
+
 func (t *TunnelService) CreateTunnelListener() (TunnelListener, error) {
-	log.Info("create tunnel listener")
+	return t.CreateTunnelListenerWithOptions(TunnelListenerOptions{TransportType: TransportTypeQuic})
+}
+
+// CreateTunnelListenerWithOptions is like CreateTunnelListener but lets the caller pick the
+// transport; TCP is a fallback for when QUIC's UDP traffic can't reach the device (see
+// DialTCPTunnel in tcp_transport.go).
+func (t *TunnelService) CreateTunnelListenerWithOptions(opts TunnelListenerOptions) (TunnelListener, error) {
+	transportType := opts.TransportType
+	if transportType == "" {
+		transportType = TransportTypeQuic
+	}
+	log.WithField("transport", transportType).Info("create tunnel listener")
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 
 	if err != nil {
@@ -239,8 +361,7 @@ func (t *TunnelService) CreateTunnelListener() (TunnelListener, error) {
 			"_0": map[string]interface{}{
 				"createListener": map[string]interface{}{
 					"key":                   der,
-					"transportProtocolType": "quic",
-					//"transportProtocolType": "tcp",
+					"transportProtocolType": string(transportType),
 				},
 			},
 		},
@@ -281,6 +402,7 @@ func (t *TunnelService) CreateTunnelListener() (TunnelListener, error) {
 		PrivateKey:      privateKey,
 		DevicePublicKey: publicKey,
 		TunnelPort:      uint64(port),
+		TransportType:   transportType,
 	}, nil
 }
 
@@ -378,6 +500,8 @@ type TunnelListener struct {
 	PrivateKey      *rsa.PrivateKey
 	DevicePublicKey interface{}
 	TunnelPort      uint64
+	// which protocol the device-side listener was created for
+	TransportType TransportType
 }
 
 type TunnelInfo struct {